@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// userItem adapts *user to bubbles/list's list.Item interface.
+type userItem struct{ u *user }
+
+func (i userItem) Title() string {
+	if i.u.DefaultPage {
+		return i.u.Username + " (default page)"
+	}
+	return i.u.Username
+}
+
+func (i userItem) Description() string {
+	if i.u.PageTitle != "" {
+		return i.u.PageTitle
+	}
+	return "(no title)"
+}
+
+func (i userItem) FilterValue() string { return i.u.Username + " " + i.u.PageTitle }
+
+type browseTab int
+
+const (
+	tabUsers browseTab = iota
+	tabNews
+)
+
+type browseModel struct {
+	data      tildeData
+	list      list.Model
+	viewport  viewport.Model
+	activeTab browseTab
+	width     int
+	height    int
+}
+
+func newBrowseModel(data tildeData, random bool) browseModel {
+	items := make([]list.Item, len(data.Users))
+	for i, u := range data.Users {
+		items[i] = userItem{u}
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.Title = fmt.Sprintf("%s — %d users", data.Name, data.UserCount)
+
+	m := browseModel{data: data, list: l, viewport: viewport.New(0, 0)}
+	m.sortByMtime()
+
+	if random {
+		m.jumpToRandomLiveUser()
+	} else {
+		m.refreshDetail()
+	}
+
+	return m
+}
+
+func (m *browseModel) sortByMtime() {
+	sort.SliceStable(m.data.Users, func(i, j int) bool {
+		return m.data.Users[i].Mtime > m.data.Users[j].Mtime
+	})
+	m.setItemsFromUsers()
+}
+
+func (m *browseModel) sortByAlpha() {
+	sort.SliceStable(m.data.Users, func(i, j int) bool {
+		return strings.ToLower(m.data.Users[i].Username) < strings.ToLower(m.data.Users[j].Username)
+	})
+	m.setItemsFromUsers()
+}
+
+func (m *browseModel) setItemsFromUsers() {
+	items := make([]list.Item, len(m.data.Users))
+	for i, u := range m.data.Users {
+		items[i] = userItem{u}
+	}
+	m.list.SetItems(items)
+}
+
+func (m *browseModel) jumpToRandomLiveUser() {
+	live := []*user{}
+	for _, u := range m.data.Users {
+		if !u.DefaultPage {
+			live = append(live, u)
+		}
+	}
+	if len(live) == 0 {
+		m.refreshDetail()
+		return
+	}
+	target := live[rand.Intn(len(live))]
+	for i, item := range m.list.Items() {
+		if item.(userItem).u.Username == target.Username {
+			m.list.Select(i)
+			break
+		}
+	}
+	m.refreshDetail()
+}
+
+func (m *browseModel) selectedUser() *user {
+	item, ok := m.list.SelectedItem().(userItem)
+	if !ok {
+		return nil
+	}
+	return item.u
+}
+
+func (m *browseModel) refreshDetail() {
+	var md string
+	switch m.activeTab {
+	case tabNews:
+		md = renderNewsMarkdown(m.data.News)
+	default:
+		md = renderUserMarkdown(m.selectedUser())
+	}
+
+	rendered, err := glamour.Render(md, "dark")
+	if err != nil {
+		rendered = md
+	}
+	m.viewport.SetContent(rendered)
+}
+
+func renderUserMarkdown(u *user) string {
+	if u == nil {
+		return "_no user selected_"
+	}
+	status := "has customized their page"
+	if u.DefaultPage {
+		status = "is still on the default page"
+	}
+	title := u.PageTitle
+	if title == "" {
+		title = "(untitled)"
+	}
+	return fmt.Sprintf("# %s\n\n**%s**\n\n%s\n", u.Username, title, status)
+}
+
+func renderNewsMarkdown(entries []newsEntry) string {
+	if len(entries) == 0 {
+		return "_no news_"
+	}
+	var sb strings.Builder
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("## %s\n\n_%s_\n\n%s\n\n---\n\n", e.Title, e.Pubdate, e.Content))
+	}
+	return sb.String()
+}
+
+func (m browseModel) Init() tea.Cmd { return nil }
+
+func (m browseModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		listWidth := m.width / 2
+		m.list.SetSize(listWidth, m.height-2)
+		m.viewport.Width = m.width - listWidth
+		m.viewport.Height = m.height - 2
+		m.refreshDetail()
+		return m, nil
+	case tea.KeyMsg:
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "tab":
+			if m.activeTab == tabUsers {
+				m.activeTab = tabNews
+			} else {
+				m.activeTab = tabUsers
+			}
+			m.refreshDetail()
+			return m, nil
+		case "m":
+			m.sortByMtime()
+			m.refreshDetail()
+			return m, nil
+		case "a":
+			m.sortByAlpha()
+			m.refreshDetail()
+			return m, nil
+		case "r":
+			m.jumpToRandomLiveUser()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	m.refreshDetail()
+	return m, cmd
+}
+
+func (m browseModel) View() string {
+	help := lipgloss.NewStyle().Faint(true).Render("tab: news/users · m: sort by mtime · a: sort alpha · r: random · q: quit")
+	return lipgloss.JoinHorizontal(lipgloss.Top, m.list.View(), m.viewport.View()) + "\n" + help
+}
+
+func loadTildeData(source string) (tildeData, error) {
+	var r io.Reader
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := http.Get(source)
+		if err != nil {
+			return tildeData{}, fmt.Errorf("could not fetch %s: %s", source, err)
+		}
+		defer resp.Body.Close()
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return tildeData{}, fmt.Errorf("could not open %s: %s", source, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var data tildeData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return tildeData{}, fmt.Errorf("could not parse tilde data from %s: %s", source, err)
+	}
+
+	return data, nil
+}
+
+func runBrowseCommand(args []string) error {
+	fs := flag.NewFlagSet("browse", flag.ExitOnError)
+	random := fs.Bool("random", false, "jump straight to a random live user")
+	fs.Parse(args)
+
+	source := "tilde.json"
+	if fs.NArg() > 0 {
+		source = fs.Arg(0)
+	}
+
+	data, err := loadTildeData(source)
+	if err != nil {
+		return err
+	}
+
+	_, err = tea.NewProgram(newBrowseModel(data, *random), tea.WithAltScreen()).Run()
+	return err
+}
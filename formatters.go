@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Renderer turns a tildeData snapshot into some serialized form, letting
+// townstats publish more than just tilde.json from the same underlying
+// scan.
+type Renderer interface {
+	Render(w io.Writer, data tildeData) error
+}
+
+// rendererFor resolves a --format flag value to a Renderer.
+func rendererFor(format string) (Renderer, error) {
+	switch format {
+	case "", "tdp":
+		return tdpRenderer{}, nil
+	case "atom":
+		return atomRenderer{}, nil
+	case "opml":
+		return opmlRenderer{}, nil
+	case "gemtext":
+		return gemtextRenderer{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// tdpRenderer emits the plain TDP JSON payload, same as townstats has
+// always produced.
+type tdpRenderer struct{}
+
+func (tdpRenderer) Render(w io.Writer, data tildeData) error {
+	enc := json.NewEncoder(w)
+	return enc.Encode(data)
+}
+
+// atomRenderer emits the town's news entries as an Atom feed.
+type atomRenderer struct{}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string `xml:"title"`
+	ID      string `xml:"id"`
+	Updated string `xml:"updated"`
+	Content string `xml:"content"`
+}
+
+// newsPubdateLayouts are the pubdate formats townstats news entries have
+// historically been written in.
+var newsPubdateLayouts = []string{
+	"2006-01-02",
+	time.RFC3339,
+	"January 2, 2006",
+}
+
+func parsePubdate(pubdate string) time.Time {
+	for _, layout := range newsPubdateLayouts {
+		if t, err := time.Parse(layout, pubdate); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (atomRenderer) Render(w io.Writer, data tildeData) error {
+	feed := atomFeed{
+		Title:   data.Name + " news",
+		ID:      data.URL + "/outbox",
+		Updated: time.Unix(data.GeneratedAtSec, 0).UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: data.URL},
+	}
+
+	for i, entry := range data.News {
+		id := fmt.Sprintf("%s/outbox/%d", data.URL, i)
+		updated := parsePubdate(entry.Pubdate)
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   entry.Title,
+			ID:      id,
+			Updated: updated.UTC().Format(time.RFC3339),
+			Content: entry.Content,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+// opmlRenderer emits an OPML 2.0 outline of every live user's
+// public_html, suitable for import into a feed reader.
+type opmlRenderer struct{}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title string `xml:"title"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text    string `xml:"text,attr"`
+	Title   string `xml:"title,attr"`
+	Type    string `xml:"type,attr"`
+	XMLURL  string `xml:"xmlUrl,attr"`
+	HTMLURL string `xml:"htmlUrl,attr"`
+}
+
+func (opmlRenderer) Render(w io.Writer, data tildeData) error {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head:    opmlHead{Title: data.Name + " residents"},
+	}
+
+	for _, u := range data.Users {
+		if u.DefaultPage {
+			continue
+		}
+		userURL := fmt.Sprintf("%s/~%s/", data.URL, u.Username)
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+			Text:    u.Username,
+			Title:   u.Username,
+			Type:    "link",
+			XMLURL:  userURL,
+			HTMLURL: userURL,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+// gemtextRenderer emits a Gemini-friendly plaintext directory listing.
+type gemtextRenderer struct{}
+
+func (gemtextRenderer) Render(w io.Writer, data tildeData) error {
+	if _, err := fmt.Fprintf(w, "# %s\n\n%s\n\n", data.Name, data.Description); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%d users, %d live, %d active\n\n", data.UserCount, data.LiveUserCount, data.ActiveUserCount); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "## residents\n\n"); err != nil {
+		return err
+	}
+	for _, u := range data.Users {
+		if u.DefaultPage {
+			continue
+		}
+		title := u.PageTitle
+		if title == "" {
+			title = u.Username
+		}
+		line := fmt.Sprintf("=> %s/~%s/ %s\n", data.URL, u.Username, title)
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,343 @@
+// Package scan discovers tilde.town users and their public_html state
+// without shelling out to ls, who, or uptime. It is used by townstats in
+// place of the serial, exec.Command-based scan in the top-level package.
+package scan
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minUID is the lowest UID townstats considers a "real" user account.
+// Anything below this is treated as a system/service account and
+// excluded from scan results, mirroring the UID ranges Debian and
+// friends reserve for system users.
+const minUID = 1000
+
+// namedSystemAccounts are excluded by username regardless of UID. This
+// predates the UID check and still earns its keep: tilde.town's cloud
+// images provision "ubuntu" at UID 1000, so UID alone wouldn't exclude
+// it. SYSTEM_USERS can append a comma-separated list of further
+// usernames to exclude without a code change.
+var namedSystemAccounts = map[string]bool{
+	"ubuntu":  true,
+	"ttadmin": true,
+	"root":    true,
+}
+
+// User is the result of scanning a single home directory.
+type User struct {
+	Username    string
+	PageTitle   string
+	Mtime       int64
+	DefaultPage bool
+}
+
+// Record is the cached state for a single user, as persisted by a Store.
+// IndexMtime is the modification time of the user's index file itself
+// (not the containing public_html directory, which in-place edits never
+// touch) at the time the record was computed, and is what Scanner checks
+// to decide whether the expensive fields below are still valid.
+type Record struct {
+	IndexMtime  int64
+	Mtime       int64
+	PageTitle   string
+	DefaultPage bool
+}
+
+// Store persists per-user Records between runs so Scanner can skip
+// recomputing title/mtime/default-page state for users whose index file
+// hasn't changed since the last scan. Changes elsewhere in public_html
+// alone do not refresh the cached Mtime.
+type Store interface {
+	Get(username string) (Record, bool, error)
+	Put(username string, rec Record) error
+}
+
+// Scanner walks a homes directory in parallel, computing per-user page
+// metadata.
+type Scanner struct {
+	HomesDir         string
+	PasswdPath       string
+	DefaultIndexHTML []byte
+	Workers          int
+
+	// Store, if set, is consulted before doing a full per-user scan and
+	// updated after. Rebuild forces every user to be rescanned
+	// regardless of what Store has cached.
+	Store   Store
+	Rebuild bool
+
+	defaultSum [sha256.Size]byte
+}
+
+// New returns a Scanner configured to compare each user's index against
+// defaultIndexHTML, with parallelism sized by GOMAXPROCS.
+func New(homesDir string, defaultIndexHTML []byte) *Scanner {
+	return &Scanner{
+		HomesDir:         homesDir,
+		PasswdPath:       "/etc/passwd",
+		DefaultIndexHTML: defaultIndexHTML,
+		Workers:          runtime.GOMAXPROCS(0),
+		defaultSum:       sha256.Sum256(defaultIndexHTML),
+	}
+}
+
+// Scan discovers every non-system user under HomesDir and fans the
+// per-user work (title, mtime, default-page detection) out across a
+// worker pool.
+func (s *Scanner) Scan() ([]*User, error) {
+	entries, err := os.ReadDir(s.HomesDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read homes dir: %s", err)
+	}
+
+	systemAccounts, err := s.systemAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("could not determine system accounts: %s", err)
+	}
+
+	usernames := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if systemAccounts[entry.Name()] {
+			continue
+		}
+		usernames = append(usernames, entry.Name())
+	}
+
+	workers := s.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan string)
+	results := make(chan *User, len(usernames))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for username := range jobs {
+				results <- s.scanUser(username)
+			}
+		}()
+	}
+
+	go func() {
+		for _, username := range usernames {
+			jobs <- username
+		}
+		close(jobs)
+	}()
+
+	wg.Wait()
+	close(results)
+
+	users := make([]*User, 0, len(usernames))
+	for u := range results {
+		users = append(users, u)
+	}
+
+	return users, nil
+}
+
+func (s *Scanner) scanUser(username string) *User {
+	dir := filepath.Join(s.HomesDir, username, "public_html")
+	indexPath := s.indexPathFor(username)
+	indexMtime := fileMtime(indexPath)
+
+	if s.Store != nil && !s.Rebuild {
+		if rec, ok, err := s.Store.Get(username); err == nil && ok && indexMtime != 0 && rec.IndexMtime == indexMtime {
+			return &User{
+				Username:    username,
+				PageTitle:   rec.PageTitle,
+				Mtime:       rec.Mtime,
+				DefaultPage: rec.DefaultPage,
+			}
+		}
+	}
+
+	u := &User{
+		Username:    username,
+		PageTitle:   pageTitle(indexPath),
+		Mtime:       mtime(dir),
+		DefaultPage: s.isDefaultPage(indexPath),
+	}
+
+	if s.Store != nil {
+		if err := s.Store.Put(username, Record{
+			IndexMtime:  indexMtime,
+			Mtime:       u.Mtime,
+			PageTitle:   u.PageTitle,
+			DefaultPage: u.DefaultPage,
+		}); err != nil {
+			log.Printf("could not cache scan state for %s: %s", username, err)
+		}
+	}
+
+	return u
+}
+
+// fileMtime returns path's own modification time, or 0 if path is empty
+// or can't be stat'd. Unlike a directory's mtime, this changes on the
+// in-place rewrites (editors, scp/rsync -t) that overwrite an index file
+// without touching its containing directory's dirents.
+func fileMtime(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.ModTime().Unix()
+}
+
+func (s *Scanner) indexPathFor(username string) string {
+	for _, name := range []string{"index.html", "index.htm"} {
+		p := filepath.Join(s.HomesDir, username, "public_html", name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+func pageTitle(indexPath string) string {
+	if indexPath == "" {
+		return ""
+	}
+	f, err := os.Open(indexPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	return titleFromReader(f)
+}
+
+func mtime(publicHTMLPath string) int64 {
+	var maxMtime int64
+	filepath.Walk(publicHTMLPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if t := info.ModTime().Unix(); t > maxMtime {
+			maxMtime = t
+		}
+		return nil
+	})
+	return maxMtime
+}
+
+// isDefaultPage compares a streamed SHA-256 of the user's index against
+// the precomputed default-page hash, so the index is never read fully
+// into memory for the comparison.
+func (s *Scanner) isDefaultPage(indexPath string) bool {
+	if indexPath == "" {
+		return false
+	}
+	f, err := os.Open(indexPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+
+	return sum == s.defaultSum
+}
+
+// systemAccounts returns the set of usernames to exclude as system/service
+// accounts: namedSystemAccounts and SYSTEM_USERS, plus anyone in
+// /etc/passwd with a UID below minUID, so that e.g. "root" and other
+// service accounts never show up as town residents.
+func (s *Scanner) systemAccounts() (map[string]bool, error) {
+	f, err := os.Open(s.PasswdPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %s", s.PasswdPath, err)
+	}
+	defer f.Close()
+
+	accounts := map[string]bool{}
+	for username := range namedSystemAccounts {
+		accounts[username] = true
+	}
+	if envSystemUsers := os.Getenv("SYSTEM_USERS"); envSystemUsers != "" {
+		for _, username := range strings.Split(envSystemUsers, ",") {
+			accounts[username] = true
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		if uid < minUID {
+			accounts[fields[0]] = true
+		}
+	}
+
+	return accounts, scanner.Err()
+}
+
+// Uptime reports how long the host has been up in a form close to
+// `uptime -p` (e.g. "up 2 day(s), 3 hour(s), 5 minute(s)"; there is no
+// weeks field), using /proc/uptime instead of shelling out.
+func Uptime() (string, error) {
+	f, err := os.Open("/proc/uptime")
+	if err != nil {
+		return "", fmt.Errorf("could not open /proc/uptime: %s", err)
+	}
+	defer f.Close()
+
+	var seconds float64
+	if _, err := fmt.Fscanf(f, "%f", &seconds); err != nil {
+		return "", fmt.Errorf("could not parse /proc/uptime: %s", err)
+	}
+
+	return formatUptime(time.Duration(seconds * float64(time.Second))), nil
+}
+
+func formatUptime(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+
+	parts := []string{}
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%d day(s)", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%d hour(s)", hours))
+	}
+	parts = append(parts, fmt.Sprintf("%d minute(s)", minutes))
+
+	return "up " + strings.Join(parts, ", ")
+}
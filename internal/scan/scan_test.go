@@ -0,0 +1,171 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// memStore is a bare in-memory Store, standing in for a real
+// statecache.Store in tests that don't need SQLite.
+type memStore struct {
+	records map[string]Record
+}
+
+func newMemStore() *memStore { return &memStore{records: map[string]Record{}} }
+
+func (m *memStore) Get(username string) (Record, bool, error) {
+	rec, ok := m.records[username]
+	return rec, ok, nil
+}
+
+func (m *memStore) Put(username string, rec Record) error {
+	m.records[username] = rec
+	return nil
+}
+
+// setupHomes builds a throwaway homes dir with n users, each owning a
+// public_html/index.html, plus a /etc/passwd classifying them as real
+// (non-system) accounts.
+func setupHomes(tb testing.TB, n int) (homesDir, passwdPath string) {
+	tb.Helper()
+
+	root := tb.TempDir()
+	homesDir = filepath.Join(root, "home")
+	passwdPath = filepath.Join(root, "passwd")
+
+	passwd := ""
+	for i := 0; i < n; i++ {
+		username := "user" + strconv.Itoa(i)
+		dir := filepath.Join(homesDir, username, "public_html")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		html := "<html><head><title>" + username + "'s page</title></head></html>"
+		if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte(html), 0644); err != nil {
+			tb.Fatal(err)
+		}
+		passwd += username + ":x:" + strconv.Itoa(1000+i) + ":1000::/home/" + username + ":/bin/sh\n"
+	}
+
+	if err := os.WriteFile(passwdPath, []byte(passwd), 0644); err != nil {
+		tb.Fatal(err)
+	}
+
+	return homesDir, passwdPath
+}
+
+func TestScanFindsAllUsers(t *testing.T) {
+	homesDir, passwdPath := setupHomes(t, 10)
+
+	s := New(homesDir, []byte("<html>default</html>"))
+	s.PasswdPath = passwdPath
+
+	users, err := s.Scan()
+	if err != nil {
+		t.Fatalf("Scan() returned error: %s", err)
+	}
+	if len(users) != 10 {
+		t.Fatalf("expected 10 users, got %d", len(users))
+	}
+	for _, u := range users {
+		if u.PageTitle == "" {
+			t.Errorf("expected a page title for %s", u.Username)
+		}
+		if u.DefaultPage {
+			t.Errorf("expected %s to not be on the default page", u.Username)
+		}
+	}
+}
+
+func TestScanExcludesSystemAccounts(t *testing.T) {
+	homesDir, passwdPath := setupHomes(t, 3)
+
+	// daemon, a system account, also has a home dir but should be excluded
+	// on UID alone (it isn't in namedSystemAccounts).
+	daemonDir := filepath.Join(homesDir, "daemon", "public_html")
+	if err := os.MkdirAll(daemonDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(passwdPath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("daemon:x:1:1::/usr/sbin:/usr/sbin/nologin\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s := New(homesDir, []byte("<html>default</html>"))
+	s.PasswdPath = passwdPath
+
+	users, err := s.Scan()
+	if err != nil {
+		t.Fatalf("Scan() returned error: %s", err)
+	}
+	for _, u := range users {
+		if u.Username == "daemon" {
+			t.Fatalf("expected daemon to be excluded as a system account")
+		}
+	}
+}
+
+func TestScanDetectsInPlaceIndexEdit(t *testing.T) {
+	homesDir, passwdPath := setupHomes(t, 1)
+
+	s := New(homesDir, []byte("<html>default</html>"))
+	s.PasswdPath = passwdPath
+	s.Store = newMemStore()
+
+	users, err := s.Scan()
+	if err != nil {
+		t.Fatalf("Scan() returned error: %s", err)
+	}
+	if got, want := users[0].PageTitle, "user0's page"; got != want {
+		t.Fatalf("initial PageTitle = %q, want %q", got, want)
+	}
+
+	// Rewrite index.html in place, the way an editor or `scp`/`rsync -t`
+	// would: truncate and overwrite the existing file rather than
+	// renaming a new one into place. This bumps the file's own mtime but,
+	// on Linux, leaves its containing public_html directory's mtime
+	// untouched.
+	indexPath := filepath.Join(homesDir, "user0", "public_html", "index.html")
+	if err := os.WriteFile(indexPath, []byte("<html><head><title>updated title</title></head></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(indexPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err = s.Scan()
+	if err != nil {
+		t.Fatalf("Scan() returned error: %s", err)
+	}
+	if got, want := users[0].PageTitle, "updated title"; got != want {
+		t.Fatalf("PageTitle after in-place edit = %q, want %q (stale cache not invalidated)", got, want)
+	}
+}
+
+func benchmarkScan(b *testing.B, workers, n int) {
+	homesDir, passwdPath := setupHomes(b, n)
+
+	s := New(homesDir, []byte("<html>default</html>"))
+	s.PasswdPath = passwdPath
+	if workers > 0 {
+		s.Workers = workers
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Scan(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanSerial(b *testing.B)   { benchmarkScan(b, 1, 200) }
+func BenchmarkScanParallel(b *testing.B) { benchmarkScan(b, 0, 200) }
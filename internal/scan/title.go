@@ -0,0 +1,23 @@
+package scan
+
+import (
+	"io"
+	"regexp"
+)
+
+var pageTitleRe = regexp.MustCompile(`<title[^>]*>(.*)</title>`)
+
+// titleFromReader extracts the contents of an HTML <title> tag. Index
+// files are small enough (public_html pages, not arbitrary uploads) that
+// reading the whole thing is still cheaper than a streaming HTML parser.
+func titleFromReader(r io.Reader) string {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return ""
+	}
+	match := pageTitleRe.FindSubmatch(content)
+	if len(match) < 2 {
+		return ""
+	}
+	return string(match[1])
+}
@@ -0,0 +1,60 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// utmp record layout, per utmp(5) on Linux (struct utmp in <utmp.h>).
+// Offsets below are for the glibc 64-bit layout; ut_user is a
+// fixed-width, NUL-padded field within each 384-byte record.
+const (
+	utmpRecordSize = 384
+	utmpTypeOffset = 0
+	utmpUserOffset = 44
+	utmpUserSize   = 32
+
+	userProcess = 7
+)
+
+func defaultUtmpPath() string {
+	if p := os.Getenv("UTMP_PATH"); p != "" {
+		return p
+	}
+	return "/var/run/utmp"
+}
+
+// ActiveUsers returns the set of distinct usernames with a USER_PROCESS
+// entry in utmp, i.e. those with an active login session. This replaces
+// shelling out to who(1).
+func ActiveUsers() (map[string]bool, error) {
+	return activeUsersFrom(defaultUtmpPath())
+}
+
+func activeUsersFrom(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read utmp file %q: %s", path, err)
+	}
+
+	users := map[string]bool{}
+	for off := 0; off+utmpRecordSize <= len(data); off += utmpRecordSize {
+		record := data[off : off+utmpRecordSize]
+
+		recType := int16(binary.LittleEndian.Uint16(record[utmpTypeOffset:]))
+		if recType != userProcess {
+			continue
+		}
+
+		raw := record[utmpUserOffset : utmpUserOffset+utmpUserSize]
+		username := string(bytes.TrimRight(raw, "\x00"))
+		if username == "" {
+			continue
+		}
+		users[username] = true
+	}
+
+	return users, nil
+}
@@ -0,0 +1,102 @@
+// Package statecache persists scan.Record state across townstats runs in
+// a small on-disk SQLite database, so incremental runs can skip
+// recomputing title/mtime/default-page state for users whose index file
+// hasn't changed.
+package statecache
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/vilmibm/townstats/internal/scan"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	username     TEXT PRIMARY KEY,
+	index_mtime  INTEGER NOT NULL,
+	mtime        INTEGER NOT NULL,
+	page_title   TEXT NOT NULL,
+	default_page INTEGER NOT NULL
+);
+`
+
+// Store is a scan.Store backed by a SQLite database file.
+type Store struct {
+	db *sql.DB
+}
+
+// Open creates path's parent directory if needed and opens (or
+// initializes) the state database there.
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("could not create cache dir %q: %s", dir, err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open state cache %q: %s", path, err)
+	}
+
+	// Scan() fans Put() out across a worker pool, but modernc.org/sqlite
+	// has no real concurrent-writer story: a second writer just gets
+	// SQLITE_BUSY. Pin the pool to a single connection so writes queue up
+	// in database/sql instead of racing each other, and enable WAL with a
+	// busy timeout as a second line of defense for any other process
+	// (e.g. a concurrent `townstats` invocation) touching the same file.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA journal_mode=WAL; PRAGMA busy_timeout=5000;"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not configure state cache: %s", err)
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not initialize state cache schema: %s", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Get returns the cached Record for username, if any.
+func (s *Store) Get(username string) (scan.Record, bool, error) {
+	var rec scan.Record
+	row := s.db.QueryRow(`SELECT index_mtime, mtime, page_title, default_page FROM users WHERE username = ?`, username)
+	err := row.Scan(&rec.IndexMtime, &rec.Mtime, &rec.PageTitle, &rec.DefaultPage)
+	if err == sql.ErrNoRows {
+		return scan.Record{}, false, nil
+	}
+	if err != nil {
+		return scan.Record{}, false, fmt.Errorf("could not read cached state for %s: %s", username, err)
+	}
+	return rec, true, nil
+}
+
+// Put upserts the Record for username.
+func (s *Store) Put(username string, rec scan.Record) error {
+	_, err := s.db.Exec(`
+		INSERT INTO users (username, index_mtime, mtime, page_title, default_page)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET
+			index_mtime=excluded.index_mtime,
+			mtime=excluded.mtime,
+			page_title=excluded.page_title,
+			default_page=excluded.default_page
+	`, username, rec.IndexMtime, rec.Mtime, rec.PageTitle, rec.DefaultPage)
+	if err != nil {
+		return fmt.Errorf("could not write cached state for %s: %s", username, err)
+	}
+	return nil
+}
+
+// Close releases the underlying database handle.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
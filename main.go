@@ -6,26 +6,27 @@
 // It is a JSON structure of the form:
 
 // Usage: stats > /var/www/html/tilde.json
+// or, to run as a long-lived server: stats serve --addr :8080
 
 package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/vilmibm/townstats/internal/scan"
+	"github.com/vilmibm/townstats/internal/statecache"
 )
 
 const defaultIndexPath = "/etc/skel/public_html/index.html"
+const defaultCachePath = "/var/cache/townstats/state.db"
 const description = `an intentional digital community for creating and sharing
 works of art, peer education, and technological anachronism. we are
 non-commercial, donation supported, and committed to rejecting false
@@ -120,101 +121,6 @@ func getNews() (entries []newsEntry, err error) {
 	return entries, nil
 }
 
-func indexPathFor(username string) (string, error) {
-	potentialPaths := []string{"index.html", "index.htm"}
-	indexPath := ""
-	errs := []error{}
-	for _, p := range potentialPaths {
-		fullPath := path.Join(homesDir(), username, "public_html", p)
-		_, staterr := os.Stat(fullPath)
-		if staterr != nil {
-			errs = append(errs, staterr)
-		} else {
-			indexPath = fullPath
-			break
-		}
-	}
-
-	if indexPath == "" {
-		return "", fmt.Errorf("Failed to locate index file for %v; tried %v; encountered errors: %v", username, potentialPaths, errs)
-	}
-
-	return indexPath, nil
-}
-
-func pageTitleFor(username string) string {
-	pageTitleRe := regexp.MustCompile(`<title[^>]*>(.*)</title>`)
-	indexPath, err := indexPathFor(username)
-	if err != nil {
-		log.Print(err)
-		return ""
-	}
-	content, err := ioutil.ReadFile(indexPath)
-	if err != nil {
-		log.Printf("failed to read %q: %v\n", indexPath, err)
-		return ""
-	}
-	titleMatch := pageTitleRe.FindStringSubmatch(string(content))
-	if len(titleMatch) < 2 {
-		return ""
-	}
-	return titleMatch[1]
-}
-
-func systemUsers() map[string]bool {
-	systemUsers := map[string]bool{
-		"ubuntu":  true,
-		"ttadmin": true,
-		"root":    true,
-	}
-	envSystemUsers := os.Getenv("SYSTEM_USERS")
-	if envSystemUsers != "" {
-		for _, username := range strings.Split(envSystemUsers, ",") {
-			systemUsers[username] = true
-		}
-	}
-
-	return systemUsers
-}
-
-func mtimeFor(username string) int64 {
-	path := path.Join(homesDir(), username, "public_html")
-	var maxMtime int64 = 0
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if maxMtime < info.ModTime().Unix() {
-			maxMtime = info.ModTime().Unix()
-		}
-		return nil
-	})
-	if err != nil {
-		log.Printf("error walking %q: %v\n", path, err)
-	}
-
-	return maxMtime
-}
-
-func detectDefaultPageFor(username string, defaultHTML []byte) bool {
-	indexPath, err := indexPathFor(username)
-	if err != nil {
-		log.Print(err)
-		return false
-	}
-	indexFile, err := os.Open(indexPath)
-	if err != nil {
-		return false
-	}
-	defer indexFile.Close()
-
-	indexHTML, err := ioutil.ReadAll(indexFile)
-	if err != nil {
-		return false
-	}
-	return bytes.Equal(indexHTML, defaultHTML)
-}
-
 func getDefaultHTML() ([]byte, error) {
 	indexPath := os.Getenv("DEFAULT_INDEX_PATH")
 	if indexPath == "" {
@@ -235,42 +141,36 @@ func getDefaultHTML() ([]byte, error) {
 	return defaultIndexHTML, nil
 }
 
-type usersByMtime []*user
-
-func getUsers() (users []*user, err error) {
-	// TODO sort by mtime
-	// For the purposes of this program, we discover users via:
-	// - presence in /home/
-	// - absence in systemUsers list (sourced from source code and potentially augmented by an environment variable)
-	// We formally used passwd parsing. This is definitely more "correct" and I'm
-	// not opposed to going back to that; going back to parsing /home is mainly to
-	// get this new version going.
+func getUsers(cachePath string, rebuild bool) (users []*user, err error) {
 	defaultIndexHTML, err := getDefaultHTML()
 	if err != nil {
 		return users, err
 	}
 
-	out, err := exec.Command("ls", homesDir()).Output()
-	if err != nil {
-		return users, fmt.Errorf("could not run ls: %s", err)
-	}
+	scanner := scan.New(homesDir(), defaultIndexHTML)
+	scanner.Rebuild = rebuild
 
-	scanner := bufio.NewScanner(bytes.NewReader(out))
+	if cachePath != "" {
+		store, err := statecache.Open(cachePath)
+		if err != nil {
+			return users, fmt.Errorf("could not open state cache: %s", err)
+		}
+		defer store.Close()
+		scanner.Store = store
+	}
 
-	systemUsers := systemUsers()
+	scanned, err := scanner.Scan()
+	if err != nil {
+		return users, fmt.Errorf("could not scan homes dir: %s", err)
+	}
 
-	for scanner.Scan() {
-		username := scanner.Text()
-		if systemUsers[username] {
-			continue
-		}
-		user := user{
-			Username:    username,
-			PageTitle:   pageTitleFor(username),
-			Mtime:       mtimeFor(username),
-			DefaultPage: detectDefaultPageFor(username, defaultIndexHTML),
-		}
-		users = append(users, &user)
+	for _, su := range scanned {
+		users = append(users, &user{
+			Username:    su.Username,
+			PageTitle:   su.PageTitle,
+			Mtime:       su.Mtime,
+			DefaultPage: su.DefaultPage,
+		})
 	}
 
 	return users, nil
@@ -287,34 +187,15 @@ func liveUserCount(users []*user) int {
 }
 
 func activeUserCount() (int, error) {
-	out, err := exec.Command("who").Output()
+	activeUsers, err := scan.ActiveUsers()
 	if err != nil {
-		return 0, fmt.Errorf("could not run who: %s", err)
+		return 0, fmt.Errorf("could not determine active users: %s", err)
 	}
-
-	scanner := bufio.NewScanner(bytes.NewReader(out))
-
-	activeUsers := map[string]bool{}
-
-	for scanner.Scan() {
-		whoLine := scanner.Text()
-		username := strings.Split(whoLine, " ")[0]
-		activeUsers[username] = true
-	}
-
 	return len(activeUsers), nil
 }
 
-func getUptime() (string, error) {
-	out, err := exec.Command("uptime").Output()
-	if err != nil {
-		return "", fmt.Errorf("could not run uptime: %s", err)
-	}
-	return strings.TrimSpace(string(out)), nil
-}
-
-func tdp() (tildeData, error) {
-	users, err := getUsers()
+func tdp(cachePath string, rebuild bool) (tildeData, error) {
+	users, err := getUsers(cachePath, rebuild)
 	if err != nil {
 		return tildeData{}, fmt.Errorf("could not get user list: %s", err)
 	}
@@ -327,7 +208,7 @@ func tdp() (tildeData, error) {
 		return tildeData{}, fmt.Errorf("could not get news: %s", err)
 	}
 
-	uptime, err := getUptime()
+	uptime, err := scan.Uptime()
 	if err != nil {
 		return tildeData{}, fmt.Errorf("could not determine uptime: %s", err)
 	}
@@ -351,13 +232,35 @@ func tdp() (tildeData, error) {
 }
 
 func main() {
-	systemData, err := tdp()
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		if err := runServeCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "browse" {
+		if err := runBrowseCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cachePath := flag.String("cache-path", defaultCachePath, "path to the on-disk state cache")
+	rebuild := flag.Bool("rebuild", false, "force a full rescan, ignoring any cached state")
+	format := flag.String("format", "tdp", "output format: tdp, atom, opml, or gemtext")
+	flag.Parse()
+
+	renderer, err := rendererFor(*format)
 	if err != nil {
 		log.Fatal(err)
 	}
-	data, err := json.Marshal(systemData)
+
+	systemData, err := tdp(*cachePath, *rebuild)
 	if err != nil {
-		log.Fatalf("Failed to marshal JSON: %s", err)
+		log.Fatal(err)
+	}
+	if err := renderer.Render(os.Stdout, systemData); err != nil {
+		log.Fatalf("Failed to render %s output: %s", *format, err)
 	}
-	fmt.Printf("%s\n", data)
 }
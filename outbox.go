@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+
+// apNote is an ActivityPub Note object representing a single news entry.
+type apNote struct {
+	Context      string `json:"@context,omitempty"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	AttributedTo string `json:"attributedTo"`
+	Published    string `json:"published"`
+	Content      string `json:"content"`
+	URL          string `json:"url"`
+}
+
+// apOutbox is an ActivityPub OrderedCollection of the town's news entries.
+type apOutbox struct {
+	Context      string   `json:"@context"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	TotalItems   int      `json:"totalItems"`
+	OrderedItems []apNote `json:"orderedItems"`
+}
+
+const newsActorURL = "https://tilde.town/outbox/actor"
+
+func newsOutbox(news []newsEntry) apOutbox {
+	items := make([]apNote, len(news))
+	for i, entry := range news {
+		id := fmt.Sprintf("https://tilde.town/outbox/%d", i)
+		items[i] = apNote{
+			ID:           id,
+			Type:         "Note",
+			AttributedTo: newsActorURL,
+			Published:    entry.Pubdate,
+			Content:      entry.Content,
+			URL:          id,
+		}
+	}
+
+	return apOutbox{
+		Context:      activityStreamsContext,
+		ID:           "https://tilde.town/outbox",
+		Type:         "OrderedCollection",
+		TotalItems:   len(items),
+		OrderedItems: items,
+	}
+}
+
+// webfingerResource is the response to a webfinger lookup for
+// acct:tilde.town@tilde.town, pointing fediverse clients at our outbox actor.
+type webfingerResource struct {
+	Subject string          `json:"subject"`
+	Links   []webfingerLink `json:"links"`
+}
+
+type webfingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+	Href string `json:"href"`
+}
+
+func webfinger(resource string) (webfingerResource, error) {
+	if resource != "acct:tilde.town@tilde.town" {
+		return webfingerResource{}, fmt.Errorf("unknown resource: %s", resource)
+	}
+
+	return webfingerResource{
+		Subject: resource,
+		Links: []webfingerLink{
+			{
+				Rel:  "self",
+				Type: "application/activity+json",
+				Href: newsActorURL,
+			},
+		},
+	}, nil
+}
+
+func (c *cache) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	data, err := c.get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/activity+json")
+	if err := json.NewEncoder(w).Encode(newsOutbox(data.News)); err != nil {
+		log.Printf("error encoding outbox response: %s", err)
+	}
+}
+
+func handleWebfinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	resp, err := webfinger(resource)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jrd+json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("error encoding webfinger response: %s", err)
+	}
+}
+
+// apPublicKey is an actor's public key, in the shape the security-v1
+// ActivityPub extension expects, so servers doing authorized fetch can
+// verify requests signed with actorKey.
+type apPublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// apActor is a minimal ActivityPub actor document for the news outbox.
+// AttributedTo and the webfinger self link both resolve here, so a
+// fediverse client doing discovery lands on something it can actually
+// Follow instead of a 404.
+type apActor struct {
+	Context           []string    `json:"@context"`
+	ID                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername"`
+	Name              string      `json:"name"`
+	Inbox             string      `json:"inbox"`
+	Outbox            string      `json:"outbox"`
+	PublicKey         apPublicKey `json:"publicKey"`
+}
+
+const newsActorInboxURL = "https://tilde.town/outbox/actor/inbox"
+
+// defaultActorKeyPath is where the actor's RSA key is persisted, next to
+// the state cache, so it survives `serve` restarts instead of rotating
+// every time.
+const defaultActorKeyPath = "/var/cache/townstats/actor_key.pem"
+
+// actorKeyOnce guards lazy initialization of actorKey: one-shot and
+// `browse` never touch the outbox/actor endpoints, so there's no reason
+// to pay for an RSA keygen (or a file read) on every invocation.
+var (
+	actorKeyOnce sync.Once
+	actorKey     *rsa.PrivateKey
+	actorKeyErr  error
+)
+
+func getActorKey() (*rsa.PrivateKey, error) {
+	actorKeyOnce.Do(func() {
+		actorKey, actorKeyErr = loadOrGenerateActorKey(defaultActorKeyPath)
+	})
+	return actorKey, actorKeyErr
+}
+
+// loadOrGenerateActorKey reads an existing PEM-encoded key from path, or
+// generates and persists a new one if none exists yet, so the actor's
+// public key stays stable across restarts.
+func loadOrGenerateActorKey(path string) (*rsa.PrivateKey, error) {
+	if der, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(der)
+		if block == nil {
+			return nil, fmt.Errorf("could not decode actor key %q: not PEM", path)
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse actor key %q: %s", path, err)
+		}
+		return key, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate actor key: %s", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("could not create actor key dir %q: %s", dir, err)
+		}
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, pemBytes, 0600); err != nil {
+		return nil, fmt.Errorf("could not persist actor key %q: %s", path, err)
+	}
+
+	return key, nil
+}
+
+func actorPublicKeyPEM(key *rsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func newsActor() (apActor, error) {
+	key, err := getActorKey()
+	if err != nil {
+		return apActor{}, err
+	}
+	return apActor{
+		Context:           []string{activityStreamsContext, "https://w3id.org/security/v1"},
+		ID:                newsActorURL,
+		Type:              "Service",
+		PreferredUsername: "tilde.town",
+		Name:              "tilde.town news",
+		Inbox:             newsActorInboxURL,
+		Outbox:            "https://tilde.town/outbox",
+		PublicKey: apPublicKey{
+			ID:           newsActorURL + "#main-key",
+			Owner:        newsActorURL,
+			PublicKeyPem: actorPublicKeyPEM(key),
+		},
+	}, nil
+}
+
+func handleActor(w http.ResponseWriter, r *http.Request) {
+	actor, err := newsActor()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/activity+json")
+	if err := json.NewEncoder(w).Encode(actor); err != nil {
+		log.Printf("error encoding actor response: %s", err)
+	}
+}
+
+// handleActorInbox acknowledges delivered activities (Follow, Undo,
+// etc.) without processing them; townstats keeps no follower list or
+// delivery queue yet, so there's nothing to do but accept receipt.
+func handleActorInbox(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusAccepted)
+}
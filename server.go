@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	userCountGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "townstats_user_count",
+		Help: "Total number of users on the town.",
+	})
+	liveUserCountGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "townstats_live_user_count",
+		Help: "Number of users who have changed their default index.html.",
+	})
+	activeUserCountGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "townstats_active_user_count",
+		Help: "Number of users with an active session.",
+	})
+	tdpDurationHistogram = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "townstats_tdp_generation_seconds",
+		Help:    "Time it takes to compute a fresh tdp() payload.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(userCountGauge, liveUserCountGauge, activeUserCountGauge, tdpDurationHistogram)
+}
+
+// cache holds the most recently generated tildeData and refreshes itself
+// in the background on a fixed interval, so handlers never block on a
+// full getUsers() walk.
+type cache struct {
+	mu        sync.RWMutex
+	data      tildeData
+	err       error
+	ttl       time.Duration
+	cachePath string
+
+	// rebuildNext forces the next refresh to ignore the on-disk state
+	// cache; it's cleared after that refresh runs.
+	rebuildNext bool
+}
+
+func newCache(ttl time.Duration, cachePath string, rebuild bool) (*cache, error) {
+	c := &cache{ttl: ttl, cachePath: cachePath, rebuildNext: rebuild}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *cache) refresh() error {
+	start := time.Now()
+	data, err := tdp(c.cachePath, c.rebuildNext)
+	c.rebuildNext = false
+	tdpDurationHistogram.Observe(time.Since(start).Seconds())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.err = err
+		return err
+	}
+	c.data = data
+	c.err = nil
+
+	userCountGauge.Set(float64(data.UserCount))
+	liveUserCountGauge.Set(float64(data.LiveUserCount))
+	activeUserCountGauge.Set(float64(data.ActiveUserCount))
+
+	return nil
+}
+
+func (c *cache) run() {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := c.refresh(); err != nil {
+			log.Printf("error refreshing tdp cache: %s", err)
+		}
+	}
+}
+
+func (c *cache) get() (tildeData, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.data, c.err
+}
+
+// handleFormat renders the cached tildeData through renderer, so every
+// published format (tilde.json, tilde.xml, town.opml, town.gmi) reads
+// from the same refresh loop.
+func (c *cache) handleFormat(renderer Renderer, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := c.get()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		if err := renderer.Render(w, data); err != nil {
+			log.Printf("error rendering %s response: %s", contentType, err)
+		}
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+// serve runs townstats as a long-lived HTTP server, refreshing the
+// cached tdp() payload every ttl instead of recomputing it per request.
+func serve(addr string, ttl time.Duration, cachePath string, rebuild bool) error {
+	c, err := newCache(ttl, cachePath, rebuild)
+	if err != nil {
+		return err
+	}
+	go c.run()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tilde.json", c.handleFormat(tdpRenderer{}, "application/json"))
+	mux.HandleFunc("/tilde.xml", c.handleFormat(atomRenderer{}, "application/atom+xml"))
+	mux.HandleFunc("/town.opml", c.handleFormat(opmlRenderer{}, "text/x-opml"))
+	mux.HandleFunc("/town.gmi", c.handleFormat(gemtextRenderer{}, "text/gemini"))
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/outbox", c.handleOutbox)
+	mux.HandleFunc("/outbox/actor", handleActor)
+	mux.HandleFunc("/outbox/actor/inbox", handleActorInbox)
+	mux.HandleFunc("/.well-known/webfinger", handleWebfinger)
+
+	log.Printf("townstats serving on %s (refresh every %s)", addr, ttl)
+	return http.ListenAndServe(addr, mux)
+}
+
+func runServeCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	ttl := fs.Duration("ttl", time.Minute, "how often to refresh the cached tdp() payload")
+	cachePath := fs.String("cache-path", defaultCachePath, "path to the on-disk state cache")
+	rebuild := fs.Bool("rebuild", false, "force a full rescan on startup, ignoring any cached state")
+	fs.Parse(args)
+
+	return serve(*addr, *ttl, *cachePath, *rebuild)
+}